@@ -0,0 +1,158 @@
+// Shared HTTP plumbing: a timeout-bound client, retries with exponential
+// backoff for transient failures, and Twitch's structured error shape.
+package twitchauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultHTTPTimeout is used when TwitchAuth.HTTPClient is unset.
+	defaultHTTPTimeout = 2 * time.Second
+	// defaultMaxRetries is how many attempts doRequest makes before giving up.
+	defaultMaxRetries = 5
+	// defaultRetryBaseDelay is the base of the exponential backoff between retries.
+	defaultRetryBaseDelay = 200 * time.Millisecond
+)
+
+// APIError is Twitch's structured error response body, surfaced whenever the
+// token, validate or revoke endpoints return a non-2xx status.
+// https://dev.twitch.tv/docs/authentication/getting-tokens-oauth
+type APIError struct {
+	Status  int    `json:"status"`
+	ErrType string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("twitch API error %d (%s): %s", e.Status, e.ErrType, e.Message)
+}
+
+// httpClient returns HTTPClient, or a client with defaultHTTPTimeout if unset.
+func (self *TwitchAuth) httpClient() *http.Client {
+	if self.HTTPClient != nil {
+		return self.HTTPClient
+	}
+	return &http.Client{Timeout: defaultHTTPTimeout}
+}
+
+// doRequest sends the request built by newReq, retrying transient failures
+// (network errors, 5xx, 429) with exponential backoff, for at most
+// defaultMaxRetries attempts in all. For 429 responses it honors the Ratelimit-Reset header when
+// present instead of the computed backoff. newReq is called again on every
+// attempt since a request's body reader can only be read once.
+//
+// On a non-2xx final response it returns a *APIError decoded from Twitch's
+// structured error body, so callers can tell a 401 (bad credentials) from a
+// 429 (rate limited) from a 5xx.
+//
+// ctx is attached to every attempt's request and is also checked between
+// retries, so a cancelled or expired ctx stops the loop early.
+func (self *TwitchAuth) doRequest(ctx context.Context, newReq func() (*http.Request, error)) ([]byte, error) {
+	client := self.httpClient()
+
+	var lastErr error
+	skipBackoff := false
+	for attempt := 0; attempt < defaultMaxRetries; attempt++ {
+		if attempt > 0 && !skipBackoff {
+			if err := sleepContext(ctx, retryBackoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+		skipBackoff = false
+
+		req, err := newReq()
+		if err != nil {
+			return nil, fmt.Errorf("Error creating new request: %v", err)
+		}
+		req = req.WithContext(ctx)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("Error sending request: %v", err)
+			continue
+		}
+
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("Error reading response body: %v", err)
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return b, nil
+		}
+
+		apiErr := &APIError{Status: resp.StatusCode}
+		json.Unmarshal(b, apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = string(b)
+		}
+		lastErr = apiErr
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// Wait out the rate limit here, then skip the generic
+			// exponential backoff on the next attempt.
+			if wait, ok := rateLimitReset(resp.Header); ok {
+				if err := sleepContext(ctx, wait); err != nil {
+					return nil, err
+				}
+				skipBackoff = true
+			}
+		case resp.StatusCode >= 500:
+			// transient, fall through to the next attempt
+		default:
+			// e.g. 400/401: retrying won't help
+			return nil, lastErr
+		}
+	}
+
+	return nil, lastErr
+}
+
+// sleepContext waits for d, returning ctx.Err() early if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryBackoff is the exponential backoff delay before the given retry
+// attempt (1-indexed; attempt 0 never sleeps).
+func retryBackoff(attempt int) time.Duration {
+	return defaultRetryBaseDelay * time.Duration(math.Pow(2, float64(attempt-1)))
+}
+
+// rateLimitReset reads Twitch's Ratelimit-Reset header, a unix timestamp of
+// when the rate limit resets, and returns how long to wait until then.
+func rateLimitReset(h http.Header) (time.Duration, bool) {
+	v := h.Get("Ratelimit-Reset")
+	if v == "" {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if wait := time.Until(time.Unix(sec, 0)); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
@@ -0,0 +1,121 @@
+package twitchauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDoRequestRetriesOn5xxThenSucceeds(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"Internal Server Error","status":500,"message":"boom"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	auth := &TwitchAuth{}
+	b, err := auth.doRequest(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest("GET", srv.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("doRequest() error: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if string(b) != `{"ok":true}` {
+		t.Fatalf("unexpected body: %s", b)
+	}
+}
+
+func TestDoRequestNonRetryableStatusStopsImmediately(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"Unauthorized","status":401,"message":"bad credentials"}`))
+	}))
+	defer srv.Close()
+
+	auth := &TwitchAuth{}
+	_, err := auth.doRequest(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest("GET", srv.URL, nil)
+	})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", apiErr.Status)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call (no retries on 401), got %d", calls)
+	}
+}
+
+// Regression test for a 429 response paying both the Ratelimit-Reset wait
+// and the generic exponential backoff before its retry.
+func TestDoRequestRateLimitDoesNotAlsoPayBackoff(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"Too Many Requests","status":429,"message":"slow down"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	auth := &TwitchAuth{}
+	start := time.Now()
+	_, err := auth.doRequest(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest("GET", srv.URL, nil)
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("doRequest() error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+	if elapsed >= defaultRetryBaseDelay {
+		t.Fatalf("retry after 429 paid the generic backoff too: took %v (>= %v)", elapsed, defaultRetryBaseDelay)
+	}
+}
+
+func TestDoRequestExhaustsRetriesOnPersistent5xx(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Internal Server Error","status":500,"message":"still broken"}`))
+	}))
+	defer srv.Close()
+
+	auth := &TwitchAuth{}
+	_, err := auth.doRequest(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest("GET", srv.URL, nil)
+	})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.Status != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", apiErr.Status)
+	}
+	if calls != defaultMaxRetries {
+		t.Fatalf("expected %d calls, got %d", defaultMaxRetries, calls)
+	}
+}
@@ -0,0 +1,164 @@
+// Pluggable persistence for token sets, so a process restart doesn't throw
+// away a refresh token and force the user through the Authorization Code
+// Grant flow again.
+package twitchauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PersistedToken is the durable form of a TwitchAuth's token set.
+type PersistedToken struct {
+	AccessToken    string    `json:"access_token"`
+	RefreshToken   string    `json:"refresh_token,omitempty"`
+	Scope          []string  `json:"scope,omitempty"`
+	ExpirationTime time.Time `json:"expiration_time"`
+}
+
+// Storage persists and restores a PersistedToken. Implementations must be
+// safe for concurrent use.
+type Storage interface {
+	Load() (*PersistedToken, error)
+	Save(*PersistedToken) error
+}
+
+// MemoryStorage is an in-memory Storage, useful for tests or short-lived
+// processes that don't need a token to survive a restart.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	token *PersistedToken
+}
+
+// Load returns the last token passed to Save, or nil if Save has not been
+// called yet.
+func (self *MemoryStorage) Load() (*PersistedToken, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.token, nil
+}
+
+func (self *MemoryStorage) Save(t *PersistedToken) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.token = t
+	return nil
+}
+
+// FileStorage persists a PersistedToken as JSON at Path.
+type FileStorage struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileStorage returns a FileStorage that reads and writes the token as
+// JSON at path.
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{Path: path}
+}
+
+// Load reads and decodes the token at Path. A missing file is not an error;
+// it returns a nil PersistedToken so callers can tell "nothing stored yet"
+// from a real failure.
+func (self *FileStorage) Load() (*PersistedToken, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b, err := os.ReadFile(self.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading token file %q: %v", self.Path, err)
+	}
+
+	var t PersistedToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("Error Decoding Json (%v) token file %q: %v", err, self.Path, string(b))
+	}
+	return &t, nil
+}
+
+// Save writes t to Path as JSON, replacing any existing contents. The write
+// goes to a temp file in the same directory first and is then renamed into
+// place, so a crash or a concurrent reader never observes a truncated or
+// partially-written file.
+func (self *FileStorage) Save(t *PersistedToken) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding token: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(self.Path), filepath.Base(self.Path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Error creating temp token file for %q: %v", self.Path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing temp token file for %q: %v", self.Path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Error closing temp token file for %q: %v", self.Path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("Error setting permissions on temp token file for %q: %v", self.Path, err)
+	}
+	if err := os.Rename(tmp.Name(), self.Path); err != nil {
+		return fmt.Errorf("Error replacing token file %q: %v", self.Path, err)
+	}
+	return nil
+}
+
+// LoadStoredToken restores a previously persisted token set from Storage, if
+// any, so a freshly constructed TwitchAuth can pick up where a previous
+// process left off. A no-op when Storage is unset or nothing has been saved
+// yet.
+func (self *TwitchAuth) LoadStoredToken() error {
+	if self.Storage == nil {
+		return nil
+	}
+	p, err := self.Storage.Load()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+
+	self.mu.Lock()
+	self.Token.AccessToken = p.AccessToken
+	self.Token.RefreshToken = p.RefreshToken
+	self.Token.Scope = p.Scope
+	self.ExpirationTime = p.ExpirationTime
+	self.mu.Unlock()
+	return nil
+}
+
+// persistToken saves the current token set to Storage, if attached. Called
+// after every successful NewTokenSet, ExchangeCode and Refresh.
+func (self *TwitchAuth) persistToken() error {
+	if self.Storage == nil {
+		return nil
+	}
+
+	self.mu.Lock()
+	p := &PersistedToken{
+		AccessToken:    self.Token.AccessToken,
+		RefreshToken:   self.Token.RefreshToken,
+		Scope:          self.Token.Scope,
+		ExpirationTime: self.ExpirationTime,
+	}
+	self.mu.Unlock()
+
+	return self.Storage.Save(p)
+}
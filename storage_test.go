@@ -0,0 +1,162 @@
+package twitchauth
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorageRoundTrip(t *testing.T) {
+	s := &MemoryStorage{}
+
+	if got, err := s.Load(); err != nil || got != nil {
+		t.Fatalf("Load() on empty storage = (%v, %v), want (nil, nil)", got, err)
+	}
+
+	want := &PersistedToken{
+		AccessToken:    "abcdefghijabcdefghijabcdefghij",
+		RefreshToken:   "a-refresh-token",
+		Scope:          []string{"user:read:email"},
+		ExpirationTime: time.Now().Add(time.Hour).Truncate(0),
+	}
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	got, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken {
+		t.Fatalf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	s := NewFileStorage(path)
+
+	if got, err := s.Load(); err != nil || got != nil {
+		t.Fatalf("Load() on missing file = (%v, %v), want (nil, nil)", got, err)
+	}
+
+	want := &PersistedToken{
+		AccessToken:    "abcdefghijabcdefghijabcdefghij",
+		RefreshToken:   "a-refresh-token",
+		Scope:          []string{"user:read:email", "chat:read"},
+		ExpirationTime: time.Now().Add(time.Hour).Truncate(0),
+	}
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	got, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got.AccessToken != want.AccessToken ||
+		got.RefreshToken != want.RefreshToken ||
+		len(got.Scope) != len(want.Scope) ||
+		!got.ExpirationTime.Equal(want.ExpirationTime) {
+		t.Fatalf("Load() = %+v, want %+v", got, want)
+	}
+
+	// No leftover temp file from the atomic rename.
+	entries, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp-*"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no leftover temp files, found %v", entries)
+	}
+}
+
+func TestFileStorageSaveOverwrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	s := NewFileStorage(path)
+
+	if err := s.Save(&PersistedToken{AccessToken: "first-token-aaaaaaaaaaaaaaaaaaa"}); err != nil {
+		t.Fatalf("first Save() error: %v", err)
+	}
+	if err := s.Save(&PersistedToken{AccessToken: "second-token-bbbbbbbbbbbbbbbbbb"}); err != nil {
+		t.Fatalf("second Save() error: %v", err)
+	}
+
+	got, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got.AccessToken != "second-token-bbbbbbbbbbbbbbbbbb" {
+		t.Fatalf("Load() = %+v, want the second saved token", got)
+	}
+}
+
+func TestLoadStoredTokenRestoresFromStorage(t *testing.T) {
+	storage := &MemoryStorage{}
+	expiry := time.Now().Add(time.Hour).Truncate(0)
+	if err := storage.Save(&PersistedToken{
+		AccessToken:    "abcdefghijabcdefghijabcdefghij",
+		RefreshToken:   "a-refresh-token",
+		Scope:          []string{"user:read:email"},
+		ExpirationTime: expiry,
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	auth := &TwitchAuth{Storage: storage}
+	if err := auth.LoadStoredToken(); err != nil {
+		t.Fatalf("LoadStoredToken() error: %v", err)
+	}
+
+	if got := auth.GetToken(); got != "abcdefghijabcdefghijabcdefghij" {
+		t.Fatalf("GetToken() = %q", got)
+	}
+	if got := auth.GetRefreshToken(); got != "a-refresh-token" {
+		t.Fatalf("GetRefreshToken() = %q", got)
+	}
+	if !auth.ExpirationTime.Equal(expiry) {
+		t.Fatalf("ExpirationTime = %v, want %v", auth.ExpirationTime, expiry)
+	}
+}
+
+func TestLoadStoredTokenNoopWithoutStorage(t *testing.T) {
+	auth := &TwitchAuth{}
+	if err := auth.LoadStoredToken(); err != nil {
+		t.Fatalf("LoadStoredToken() error: %v", err)
+	}
+	if auth.GetToken() != "" {
+		t.Fatalf("GetToken() = %q, want empty", auth.GetToken())
+	}
+}
+
+func TestExchangeCodePersistsToStorage(t *testing.T) {
+	withTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"access_token": "abcdefghijabcdefghijabcdefghij",
+			"refresh_token": "a-refresh-token",
+			"expires_in": 14400
+		}`))
+	})
+
+	storage := &MemoryStorage{}
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret", Storage: storage}
+
+	if err := auth.ExchangeCode("a-code", "https://example.com/callback"); err != nil {
+		t.Fatalf("ExchangeCode() error: %v", err)
+	}
+
+	persisted, err := storage.Load()
+	if err != nil {
+		t.Fatalf("storage.Load() error: %v", err)
+	}
+	if persisted == nil {
+		t.Fatal("expected ExchangeCode to persist the token, got nothing saved")
+	}
+	if persisted.AccessToken != "abcdefghijabcdefghijabcdefghij" {
+		t.Fatalf("persisted.AccessToken = %q", persisted.AccessToken)
+	}
+	if persisted.RefreshToken != "a-refresh-token" {
+		t.Fatalf("persisted.RefreshToken = %q", persisted.RefreshToken)
+	}
+}
@@ -0,0 +1,168 @@
+// Background auto-refreshing token source, modeled on golang.org/x/oauth2's
+// TokenSource/expiryDelta pattern.
+package twitchauth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultExpiryDelta is how long before a token's real expiration it is
+// treated as already expired, the same idea as x/oauth2's expiryDelta.
+const defaultExpiryDelta = 10 * time.Second
+
+const (
+	// autoRefreshBackoffBase is the base of the exponential backoff
+	// autoRefreshLoop applies between proactive refresh attempts after a
+	// failure, so a persistently failing endpoint or a revoked refresh token
+	// isn't hammered on every expiryDelta tick.
+	autoRefreshBackoffBase = defaultExpiryDelta
+	// maxAutoRefreshBackoff caps how long autoRefreshLoop waits between
+	// retries after repeated failures.
+	maxAutoRefreshBackoff = 5 * time.Minute
+)
+
+// TokenSource supplies a valid access token, refreshing it as needed.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// AutoRefreshingSource wraps a TwitchAuth and transparently refreshes its
+// Token before it expires. Concurrent calls to Token coalesce into a single
+// refresh under mu instead of racing on NewTokenSet/Refresh.
+type AutoRefreshingSource struct {
+	Auth *TwitchAuth
+	// ExpiryDelta is how long before expiry Token refreshes early.
+	// Defaults to defaultExpiryDelta when zero.
+	ExpiryDelta time.Duration
+	// OnError, if set, is called from the background loop started by
+	// StartAutoRefresh whenever a proactive refresh fails. Token's coalesced
+	// refresh still reports its own errors directly to the caller regardless
+	// of OnError.
+	OnError func(error)
+
+	mu     sync.Mutex
+	stop   chan struct{}
+	closed bool
+}
+
+// NewAutoRefreshingSource wraps auth in an AutoRefreshingSource. auth should
+// already hold a Token, e.g. from NewTokenSet or ExchangeCode.
+func NewAutoRefreshingSource(auth *TwitchAuth) *AutoRefreshingSource {
+	return &AutoRefreshingSource{Auth: auth}
+}
+
+// Returns the current access token, refreshing it first if it is within
+// ExpiryDelta of expiring. Concurrent callers coalesce into one refresh.
+func (self *AutoRefreshingSource) Token() (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.needsRefresh() {
+		if err := self.refresh(); err != nil {
+			return "", err
+		}
+	}
+	return self.Auth.GetToken(), nil
+}
+
+// Starts a goroutine that proactively refreshes the token at
+// ExpirationTime - delta, instead of waiting for the next Token call to
+// notice it's stale. A failed refresh backs off exponentially instead of
+// retrying every delta, and is reported to OnError if set. Call Close to
+// stop it.
+func (self *AutoRefreshingSource) StartAutoRefresh() {
+	self.mu.Lock()
+	if self.stop != nil {
+		self.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	self.stop = stop
+	self.mu.Unlock()
+
+	go self.autoRefreshLoop(stop)
+}
+
+// Stops the background refresh goroutine started by StartAutoRefresh, if
+// any. Safe to call more than once.
+func (self *AutoRefreshingSource) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.stop != nil && !self.closed {
+		close(self.stop)
+		self.closed = true
+	}
+	return nil
+}
+
+func (self *AutoRefreshingSource) autoRefreshLoop(stop chan struct{}) {
+	var consecutiveFailures int
+	for {
+		var wait time.Duration
+		if consecutiveFailures > 0 {
+			wait = autoRefreshBackoff(consecutiveFailures)
+		} else {
+			wait = self.Auth.TimeTillExpiration() - self.expiryDelta()
+			if wait <= 0 {
+				wait = self.expiryDelta()
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+			self.mu.Lock()
+			err := self.refresh()
+			onError := self.OnError
+			self.mu.Unlock()
+
+			if err != nil {
+				consecutiveFailures++
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			consecutiveFailures = 0
+		case <-stop:
+			return
+		}
+	}
+}
+
+// autoRefreshBackoff is the exponential backoff, capped at
+// maxAutoRefreshBackoff, applied after consecutiveFailures proactive refresh
+// attempts in a row have failed.
+func autoRefreshBackoff(consecutiveFailures int) time.Duration {
+	d := autoRefreshBackoffBase * time.Duration(math.Pow(2, float64(consecutiveFailures-1)))
+	if d <= 0 || d > maxAutoRefreshBackoff {
+		return maxAutoRefreshBackoff
+	}
+	return d
+}
+
+// needsRefresh reports whether the current token is missing or within
+// ExpiryDelta of expiring. Callers must hold mu. Reads Auth's state through
+// its own locked accessors, since Auth.ExpirationTime and Auth.Token can also
+// be written directly by StartValidityCheck or a bare Refresh/NewTokenSet
+// call made outside this source.
+func (self *AutoRefreshingSource) needsRefresh() bool {
+	return self.Auth.GetToken() == "" || self.Auth.TimeTillExpiration() <= self.expiryDelta()
+}
+
+// refresh re-fetches the token, preferring Refresh when a refresh token is
+// already on hand. Callers must hold mu.
+func (self *AutoRefreshingSource) refresh() error {
+	if self.Auth.GetRefreshToken() != "" {
+		return self.Auth.Refresh()
+	}
+	return self.Auth.NewTokenSet()
+}
+
+func (self *AutoRefreshingSource) expiryDelta() time.Duration {
+	if self.ExpiryDelta == 0 {
+		return defaultExpiryDelta
+	}
+	return self.ExpiryDelta
+}
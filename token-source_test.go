@@ -0,0 +1,40 @@
+package twitchauth
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Exercises AutoRefreshingSource.Token alongside a goroutine that writes
+// ExpirationTime directly, the way StartValidityCheck does. Run with -race;
+// it catches a regression where TwitchAuth.Token/ExpirationTime are touched
+// without TwitchAuth.mu.
+func TestAutoRefreshingSourceConcurrentToken(t *testing.T) {
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret"}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij" // 30 chars, matches twitchAuthTokenRegex
+	auth.ExpirationTime = time.Now().Add(time.Hour)
+
+	src := NewAutoRefreshingSource(auth)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := src.Token(); err != nil {
+				t.Errorf("Token() error: %v", err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		auth.mu.Lock()
+		auth.ExpirationTime = time.Now().Add(2 * time.Hour)
+		auth.mu.Unlock()
+	}()
+
+	wg.Wait()
+}
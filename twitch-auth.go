@@ -3,36 +3,55 @@
 package twitchauth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Constants for the Twitch API
 const (
-	// Twitch API URL
-	twitchAuthTokenURL = "https://id.twitch.tv/oauth2/token"
+	// Twitch authorization URL, used to start the Authorization Code Grant flow
+	twitchAuthAuthorizeURL = "https://id.twitch.tv/oauth2/authorize"
 	// Regex for Twitch OAuth token
 	twitchAuthTokenRegex = `[a-zA-Z0-9]{30}`
 )
 
+// twitchAuthTokenURL is the Twitch API token endpoint. A var, rather than a
+// const, so tests in this package can point it at an httptest.Server.
+var twitchAuthTokenURL = "https://id.twitch.tv/oauth2/token"
+
 // TwitchAuth is the struct for the Twitch API
 type TwitchAuth struct {
 	ClientID       string
 	Secret         string
 	ExpirationTime time.Time // Time Token was received in time.Time
 	Token          token
+	// HTTPClient is used for all requests to the Twitch API. Defaults to a
+	// client with a defaultHTTPTimeout timeout when left nil.
+	HTTPClient *http.Client
+	// Storage, when set, persists the token set after every successful
+	// NewTokenSet, ExchangeCode and Refresh. Use LoadStoredToken to restore
+	// it on startup.
+	Storage Storage
+
+	// mu guards Token and ExpirationTime, which requestToken, StartValidityCheck
+	// and LoadStoredToken can all write from different goroutines.
+	mu sync.Mutex
 }
 
 // token is the response from the Twitch API
 type token struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int64  `json:"expires_in"`
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	TokenType    string   `json:"token_type"`
+	ExpiresIn    int64    `json:"expires_in"`
+	Scope        []string `json:"scope,omitempty"`
 }
 
 type TwitchAuthInterface interface {
@@ -44,12 +63,23 @@ type TwitchAuthInterface interface {
 
 // Returns Token
 func (self *TwitchAuth) GetToken() string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	if self.Token.AccessToken == "" {
 		return ""
 	}
 	return self.Token.AccessToken
 }
 
+// Returns the refresh token obtained from ExchangeCode or Refresh, or an
+// empty string if this TwitchAuth has not completed the Authorization Code
+// Grant flow.
+func (self *TwitchAuth) GetRefreshToken() string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.Token.RefreshToken
+}
+
 // Returns Token Information as string.
 func (self *TwitchAuth) String() string {
 	return fmt.Sprintf("Token Expired: %v\nExpiration %v\n",
@@ -60,49 +90,117 @@ func (self *TwitchAuth) String() string {
 
 // Returns duration until token expires
 func (self *TwitchAuth) TimeTillExpiration() time.Duration {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	return self.ExpirationTime.Sub(time.Now())
 }
 
 // returns true if the token is expired
 func (self *TwitchAuth) Isexpired() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	return !self.ExpirationTime.After(time.Now())
 }
 
 // Obtains a new Token set from the Twitch API
 // Token set includes access token, Type, expiration time
 func (self *TwitchAuth) NewTokenSet() error {
-	re, err := regexp.Compile(twitchAuthTokenRegex)
-	if err != nil {
-		return fmt.Errorf("Error compiling regex: %v with '%s'", err, twitchAuthTokenRegex)
-	}
-	var t token
+	return self.NewTokenSetContext(context.Background())
+}
+
+// Like NewTokenSet, but honors ctx cancellation and deadlines for the
+// underlying request.
+func (self *TwitchAuth) NewTokenSetContext(ctx context.Context) error {
 	// Client credentials grant flow
 	// https://dev.twitch.tv/docs/authentication/getting-tokens-oauth#oauth-client-credentials-flow
 	data := url.Values{}
 	data.Set("client_id", self.ClientID)
 	data.Set("client_secret", self.Secret)
 	data.Set("grant_type", "client_credentials")
-	req, err := http.NewRequest("POST", twitchAuthTokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return fmt.Errorf("Error creating new request: %v", err)
+	return self.requestToken(ctx, data)
+}
+
+// Builds the URL a user should be redirected to in order to grant this
+// application access to their account via the Authorization Code Grant flow.
+// https://dev.twitch.tv/docs/authentication/getting-tokens-oauth#authorization-code-grant-flow
+func (self *TwitchAuth) AuthorizationURL(redirectURI string, scopes []string, state string) string {
+	v := url.Values{}
+	v.Set("client_id", self.ClientID)
+	v.Set("redirect_uri", redirectURI)
+	v.Set("response_type", "code")
+	v.Set("scope", strings.Join(scopes, " "))
+	if state != "" {
+		v.Set("state", state)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return twitchAuthAuthorizeURL + "?" + v.Encode()
+}
 
-	// Send Request to Twitch API
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error getting token set: %v", err)
+// Exchanges an Authorization Code Grant code for a user Token set, populating
+// Token and RefreshToken on success.
+// https://dev.twitch.tv/docs/authentication/getting-tokens-oauth#authorization-code-grant-flow
+func (self *TwitchAuth) ExchangeCode(code, redirectURI string) error {
+	return self.ExchangeCodeContext(context.Background(), code, redirectURI)
+}
+
+// Like ExchangeCode, but honors ctx cancellation and deadlines for the
+// underlying request.
+func (self *TwitchAuth) ExchangeCodeContext(ctx context.Context, code, redirectURI string) error {
+	data := url.Values{}
+	data.Set("client_id", self.ClientID)
+	data.Set("client_secret", self.Secret)
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+	data.Set("redirect_uri", redirectURI)
+	return self.requestToken(ctx, data)
+}
+
+// Exchanges the current RefreshToken for a new Token set. It does not check
+// whether the current token has expired; it refreshes whenever called.
+// https://dev.twitch.tv/docs/authentication/refresh-tokens
+func (self *TwitchAuth) Refresh() error {
+	return self.RefreshContext(context.Background())
+}
+
+// Like Refresh, but honors ctx cancellation and deadlines for the underlying
+// request.
+func (self *TwitchAuth) RefreshContext(ctx context.Context) error {
+	refreshToken := self.GetRefreshToken()
+	if refreshToken == "" {
+		return fmt.Errorf("no refresh token available, call ExchangeCode first")
 	}
+	data := url.Values{}
+	data.Set("client_id", self.ClientID)
+	data.Set("client_secret", self.Secret)
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	return self.requestToken(ctx, data)
+}
 
-	// Close the body when done reading from it
-	defer resp.Body.Close()
+// Posts the given form values to the Twitch token endpoint and, on success,
+// decodes the response into Token and updates ExpirationTime. Shared by
+// NewTokenSet, ExchangeCode and Refresh, which only differ in grant_type and
+// the values they POST.
+func (self *TwitchAuth) requestToken(ctx context.Context, data url.Values) error {
+	re, err := regexp.Compile(twitchAuthTokenRegex)
+	if err != nil {
+		return fmt.Errorf("Error compiling regex: %v with '%s'", err, twitchAuthTokenRegex)
+	}
 
-	// Read response body into a byte slice
-	b := make([]byte, resp.ContentLength)
-	resp.Body.Read(b)
+	b, err := self.doRequest(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", twitchAuthTokenURL, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
 
 	// Decode the JSON response into the token struct
 	// Return error on failure.
+	var t token
 	if err := json.Unmarshal(b, &t); err != nil {
 		return fmt.Errorf("Error Decoding Json (%v) response Body: %v", err, string(b))
 	}
@@ -113,7 +211,14 @@ func (self *TwitchAuth) NewTokenSet() error {
 	}
 
 	// Set the token, and the time that it will expire.
+	self.mu.Lock()
 	self.Token = t
 	self.ExpirationTime = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	self.mu.Unlock()
+
+	// Persisting is best-effort: the fetched token is already valid and set
+	// on self, so a Storage failure here shouldn't be reported as an auth
+	// failure to the caller.
+	self.persistToken()
 	return nil
 }
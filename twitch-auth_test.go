@@ -0,0 +1,162 @@
+package twitchauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTokenServer points twitchAuthTokenURL at srv for the duration of the
+// test, restoring it on cleanup.
+func withTokenServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	original := twitchAuthTokenURL
+	twitchAuthTokenURL = srv.URL
+	t.Cleanup(func() { twitchAuthTokenURL = original })
+
+	return srv
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	auth := &TwitchAuth{ClientID: "my-client-id"}
+	got := auth.AuthorizationURL("https://example.com/callback", []string{"user:read:email", "chat:read"}, "xyzstate")
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("AuthorizationURL produced an invalid URL: %v", err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != twitchAuthAuthorizeURL {
+		t.Fatalf("unexpected base URL: %s", got)
+	}
+
+	q := u.Query()
+	if q.Get("client_id") != "my-client-id" {
+		t.Fatalf("client_id = %q", q.Get("client_id"))
+	}
+	if q.Get("redirect_uri") != "https://example.com/callback" {
+		t.Fatalf("redirect_uri = %q", q.Get("redirect_uri"))
+	}
+	if q.Get("response_type") != "code" {
+		t.Fatalf("response_type = %q", q.Get("response_type"))
+	}
+	if q.Get("state") != "xyzstate" {
+		t.Fatalf("state = %q", q.Get("state"))
+	}
+	if q.Get("scope") != "user:read:email chat:read" {
+		t.Fatalf("scope = %q", q.Get("scope"))
+	}
+}
+
+func TestExchangeCodeSuccess(t *testing.T) {
+	withTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		if r.Form.Get("grant_type") != "authorization_code" {
+			t.Fatalf("grant_type = %q", r.Form.Get("grant_type"))
+		}
+		if r.Form.Get("code") != "a-valid-code" {
+			t.Fatalf("code = %q", r.Form.Get("code"))
+		}
+		w.Write([]byte(`{
+			"access_token": "abcdefghijabcdefghijabcdefghij",
+			"refresh_token": "refreshtokenvalue",
+			"token_type": "bearer",
+			"expires_in": 14400,
+			"scope": ["user:read:email"]
+		}`))
+	})
+
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret"}
+	if err := auth.ExchangeCode("a-valid-code", "https://example.com/callback"); err != nil {
+		t.Fatalf("ExchangeCode() error: %v", err)
+	}
+
+	if got := auth.GetToken(); got != "abcdefghijabcdefghijabcdefghij" {
+		t.Fatalf("GetToken() = %q", got)
+	}
+	if got := auth.GetRefreshToken(); got != "refreshtokenvalue" {
+		t.Fatalf("GetRefreshToken() = %q", got)
+	}
+	if auth.Isexpired() {
+		t.Fatal("token should not be expired immediately after ExchangeCode")
+	}
+}
+
+func TestExchangeCodeEmptyCodeRejectedByServer(t *testing.T) {
+	withTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		if r.Form.Get("code") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":400,"error":"Bad Request","message":"missing code parameter"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"abcdefghijabcdefghijabcdefghij","expires_in":14400}`))
+	})
+
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret"}
+	err := auth.ExchangeCode("", "https://example.com/callback")
+	if err == nil {
+		t.Fatal("expected an error for an empty code, got nil")
+	}
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.Status != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", apiErr.Status)
+	}
+	if auth.GetToken() != "" {
+		t.Fatalf("GetToken() should remain empty after a failed exchange, got %q", auth.GetToken())
+	}
+}
+
+func TestRefreshWithoutRefreshToken(t *testing.T) {
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret"}
+	err := auth.Refresh()
+	if err == nil {
+		t.Fatal("expected an error when no refresh token is set")
+	}
+	if !strings.Contains(err.Error(), "no refresh token available") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRefreshSuccess(t *testing.T) {
+	withTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		if r.Form.Get("grant_type") != "refresh_token" {
+			t.Fatalf("grant_type = %q", r.Form.Get("grant_type"))
+		}
+		if r.Form.Get("refresh_token") != "old-refresh-token" {
+			t.Fatalf("refresh_token = %q", r.Form.Get("refresh_token"))
+		}
+		w.Write([]byte(`{
+			"access_token": "zyxwvutsrqzyxwvutsrqzyxwvutsrq",
+			"refresh_token": "new-refresh-token",
+			"expires_in": 14400
+		}`))
+	})
+
+	auth := &TwitchAuth{ClientID: "id", Secret: "secret"}
+	auth.Token.RefreshToken = "old-refresh-token"
+
+	if err := auth.Refresh(); err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+	if got := auth.GetToken(); got != "zyxwvutsrqzyxwvutsrqzyxwvutsrq" {
+		t.Fatalf("GetToken() = %q", got)
+	}
+	if got := auth.GetRefreshToken(); got != "new-refresh-token" {
+		t.Fatalf("GetRefreshToken() = %q", got)
+	}
+}
@@ -0,0 +1,138 @@
+// Token validation and revocation against Twitch's validate/revoke endpoints.
+package twitchauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenValidityRecheckInterval is how often StartValidityCheck re-validates
+// the token. Twitch requires apps to validate tokens hourly.
+// https://dev.twitch.tv/docs/authentication/validate-tokens
+const tokenValidityRecheckInterval = time.Hour
+
+// Twitch validate/revoke endpoints. Vars, rather than consts, so tests in
+// this package can point them at an httptest.Server.
+var (
+	twitchValidateURL = "https://id.twitch.tv/oauth2/validate"
+	twitchRevokeURL   = "https://id.twitch.tv/oauth2/revoke"
+)
+
+// ValidationResponse is the response from Twitch's validate endpoint.
+// https://dev.twitch.tv/docs/authentication/validate-tokens
+type ValidationResponse struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	Scopes    []string `json:"scopes"`
+	UserID    string   `json:"user_id"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+// Validate checks the current Token against Twitch's validate endpoint.
+// Twitch requires this at least once an hour for app tokens.
+// https://dev.twitch.tv/docs/authentication/validate-tokens
+func (self *TwitchAuth) Validate() (*ValidationResponse, error) {
+	return self.ValidateContext(context.Background())
+}
+
+// Like Validate, but honors ctx cancellation and deadlines for the
+// underlying request.
+func (self *TwitchAuth) ValidateContext(ctx context.Context) (*ValidationResponse, error) {
+	b, err := self.doRequest(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", twitchValidateURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "OAuth "+self.GetToken())
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var v ValidationResponse
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("Error Decoding Json (%v) response Body: %v", err, string(b))
+	}
+
+	return &v, nil
+}
+
+// Revoke invalidates the current Token with Twitch, e.g. on user logout.
+// https://dev.twitch.tv/docs/authentication/revoke-tokens
+func (self *TwitchAuth) Revoke() error {
+	return self.RevokeContext(context.Background())
+}
+
+// Like Revoke, but honors ctx cancellation and deadlines for the underlying
+// request.
+func (self *TwitchAuth) RevokeContext(ctx context.Context) error {
+	data := url.Values{}
+	data.Set("client_id", self.ClientID)
+	data.Set("token", self.GetToken())
+
+	_, err := self.doRequest(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", twitchRevokeURL, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	return err
+}
+
+// StartValidityCheck spawns a goroutine that calls Validate every
+// tokenValidityRecheckInterval and refreshes ExpirationTime from the
+// response, so a long-lived client notices server-side revocation instead of
+// trusting stale local expiry. When Validate fails (e.g. a 401 because the
+// token was revoked), ExpirationTime is forced into the past so Isexpired
+// reports true immediately, and onError, if non-nil, is called with the
+// failure so the caller can react, e.g. by re-authenticating. Call the
+// returned func to stop it.
+func (self *TwitchAuth) StartValidityCheck(onError func(error)) (stop func()) {
+	stopCh := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(tokenValidityRecheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.runValidityCheck(onError)
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stopCh) })
+	}
+}
+
+// runValidityCheck performs a single Validate call and updates ExpirationTime
+// from it, forcing ExpirationTime into the past on failure. Split out from
+// StartValidityCheck's ticker loop so it can be exercised directly in tests
+// without waiting out tokenValidityRecheckInterval.
+func (self *TwitchAuth) runValidityCheck(onError func(error)) {
+	v, err := self.Validate()
+	self.mu.Lock()
+	if err != nil {
+		self.ExpirationTime = time.Now().Add(-time.Second)
+	} else {
+		self.ExpirationTime = time.Now().Add(time.Duration(v.ExpiresIn) * time.Second)
+	}
+	self.mu.Unlock()
+
+	if err != nil && onError != nil {
+		onError(err)
+	}
+}
@@ -0,0 +1,149 @@
+package twitchauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withValidateServer points twitchValidateURL at srv for the duration of the
+// test, restoring it on cleanup.
+func withValidateServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	original := twitchValidateURL
+	twitchValidateURL = srv.URL
+	t.Cleanup(func() { twitchValidateURL = original })
+
+	return srv
+}
+
+// withRevokeServer points twitchRevokeURL at srv for the duration of the
+// test, restoring it on cleanup.
+func withRevokeServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	original := twitchRevokeURL
+	twitchRevokeURL = srv.URL
+	t.Cleanup(func() { twitchRevokeURL = original })
+
+	return srv
+}
+
+func TestValidateSuccess(t *testing.T) {
+	withValidateServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "OAuth abcdefghijabcdefghijabcdefghij" {
+			t.Fatalf("Authorization header = %q", got)
+		}
+		w.Write([]byte(`{
+			"client_id": "id",
+			"login": "some_user",
+			"scopes": ["user:read:email"],
+			"user_id": "1234",
+			"expires_in": 3600
+		}`))
+	})
+
+	auth := &TwitchAuth{}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij"
+
+	v, err := auth.Validate()
+	if err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	if v.Login != "some_user" {
+		t.Fatalf("Login = %q", v.Login)
+	}
+	if v.ExpiresIn != 3600 {
+		t.Fatalf("ExpiresIn = %d", v.ExpiresIn)
+	}
+}
+
+func TestValidateFailure(t *testing.T) {
+	withValidateServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"status":401,"error":"Unauthorized","message":"invalid access token"}`))
+	})
+
+	auth := &TwitchAuth{}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij"
+
+	_, err := auth.Validate()
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", apiErr.Status)
+	}
+}
+
+func TestRevokeSuccess(t *testing.T) {
+	var gotToken string
+	withRevokeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		gotToken = r.Form.Get("token")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	auth := &TwitchAuth{ClientID: "id"}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij"
+
+	if err := auth.Revoke(); err != nil {
+		t.Fatalf("Revoke() error: %v", err)
+	}
+	if gotToken != "abcdefghijabcdefghijabcdefghij" {
+		t.Fatalf("revoked token = %q", gotToken)
+	}
+}
+
+func TestRunValidityCheckSuccessUpdatesExpiration(t *testing.T) {
+	withValidateServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"client_id":"id","expires_in":3600}`))
+	})
+
+	auth := &TwitchAuth{}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij"
+	auth.ExpirationTime = time.Now().Add(-time.Hour) // stale, as if about to expire
+
+	var onErrorCalls int
+	auth.runValidityCheck(func(error) { onErrorCalls++ })
+
+	if auth.Isexpired() {
+		t.Fatal("ExpirationTime should have been refreshed from the validate response")
+	}
+	if onErrorCalls != 0 {
+		t.Fatalf("onError should not be called on success, got %d calls", onErrorCalls)
+	}
+}
+
+// Regression test for the fix that made StartValidityCheck actually surface
+// server-side revocation: a failed validate must force ExpirationTime into
+// the past and invoke onError.
+func TestRunValidityCheckFailureForcesExpiryAndCallsOnError(t *testing.T) {
+	withValidateServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"status":401,"error":"Unauthorized","message":"token revoked"}`))
+	})
+
+	auth := &TwitchAuth{}
+	auth.Token.AccessToken = "abcdefghijabcdefghijabcdefghij"
+	auth.ExpirationTime = time.Now().Add(time.Hour) // still looks valid locally
+
+	var gotErr error
+	auth.runValidityCheck(func(err error) { gotErr = err })
+
+	if !auth.Isexpired() {
+		t.Fatal("a failed validate should force ExpirationTime into the past")
+	}
+	if gotErr == nil {
+		t.Fatal("expected onError to be called with the validate failure")
+	}
+}